@@ -0,0 +1,29 @@
+package netrc
+
+import (
+	"io"
+
+	"filippo.io/age"
+)
+
+// AgeCipher encrypts and decrypts netrc files using age
+// (https://age-encryption.org). Unlike GPGCipher it never shells out to
+// a subprocess or depends on a running gpg-agent, so it works cleanly
+// on headless CI. It is registered for the ".age" extension by default,
+// but Identities/Recipients must be set (typically via ParseWithCipher
+// and SaveWithCipher) before it can actually decrypt or encrypt.
+type AgeCipher struct {
+	Identities []age.Identity
+	Recipients []age.Recipient
+}
+
+// Decrypt decrypts an age-encrypted netrc file using Identities.
+func (a *AgeCipher) Decrypt(r io.Reader) (io.Reader, error) {
+	return age.Decrypt(r, a.Identities...)
+}
+
+// Encrypt returns a WriteCloser that age-encrypts plaintext written to
+// it, for Recipients.
+func (a *AgeCipher) Encrypt(w io.Writer) (io.WriteCloser, error) {
+	return age.Encrypt(w, a.Recipients...)
+}
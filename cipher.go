@@ -0,0 +1,28 @@
+package netrc
+
+import "io"
+
+// Cipher encrypts and decrypts netrc files for storage at rest. Parse
+// and Save infer a Cipher from the file's extension via the registry
+// populated by RegisterCipher; ParseWithCipher and SaveWithCipher take
+// one explicitly.
+type Cipher interface {
+	Decrypt(r io.Reader) (io.Reader, error)
+	Encrypt(w io.Writer) (io.WriteCloser, error)
+}
+
+var ciphers = map[string]Cipher{}
+
+// RegisterCipher registers c as the Cipher used for files with the
+// given extension, including the leading dot (e.g. ".gpg"). It is
+// typically called from an init function by packages that want Parse
+// and Save to transparently decrypt/encrypt a new file type, such as
+// sops or a keyring-backed cipher.
+func RegisterCipher(ext string, c Cipher) {
+	ciphers[ext] = c
+}
+
+func init() {
+	RegisterCipher(".gpg", &GPGCipher{})
+	RegisterCipher(".age", &AgeCipher{})
+}
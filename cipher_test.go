@@ -0,0 +1,109 @@
+package netrc
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+
+	"filippo.io/age"
+
+	. "gopkg.in/check.v1"
+)
+
+type CipherSuite struct{}
+
+var _ = Suite(&CipherSuite{})
+
+type recordingCipher struct {
+	decrypted bool
+	encrypted bool
+}
+
+func (c *recordingCipher) Decrypt(r io.Reader) (io.Reader, error) {
+	c.decrypted = true
+	return r, nil
+}
+
+func (c *recordingCipher) Encrypt(w io.Writer) (io.WriteCloser, error) {
+	c.encrypted = true
+	return nopWriteCloser{w}, nil
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+func (s *CipherSuite) TestParseAndSaveWithCipher(c *C) {
+	path := filepath.Join(c.MkDir(), "test.netrc")
+	c.Assert(ioutil.WriteFile(path, []byte("machine m\nlogin l\npassword p\n"), 0600), IsNil)
+
+	dc := &recordingCipher{}
+	n, err := ParseWithCipher(path, dc)
+	c.Assert(err, IsNil)
+	c.Check(dc.decrypted, Equals, true)
+	c.Check(n.Machine("m").Get("login"), Equals, "l")
+
+	ec := &recordingCipher{}
+	c.Assert(n.SaveWithCipher(ec), IsNil)
+	c.Check(ec.encrypted, Equals, true)
+
+	body, err := ioutil.ReadFile(path)
+	c.Assert(err, IsNil)
+	c.Check(string(body), Equals, n.Render())
+}
+
+func (s *CipherSuite) TestAgeCipherRoundTrip(c *C) {
+	id, err := age.GenerateX25519Identity()
+	c.Assert(err, IsNil)
+
+	ac := &AgeCipher{Identities: []age.Identity{id}, Recipients: []age.Recipient{id.Recipient()}}
+	plaintext := []byte("machine m\nlogin l\npassword p\n")
+
+	var ciphertext bytes.Buffer
+	w, err := ac.Encrypt(&ciphertext)
+	c.Assert(err, IsNil)
+	_, err = w.Write(plaintext)
+	c.Assert(err, IsNil)
+	c.Assert(w.Close(), IsNil)
+
+	r, err := ac.Decrypt(&ciphertext)
+	c.Assert(err, IsNil)
+	got, err := ioutil.ReadAll(r)
+	c.Assert(err, IsNil)
+	c.Check(got, DeepEquals, plaintext)
+}
+
+func (s *CipherSuite) TestAgeCipherThroughParseAndSaveWithCipher(c *C) {
+	id, err := age.GenerateX25519Identity()
+	c.Assert(err, IsNil)
+	ac := &AgeCipher{Identities: []age.Identity{id}, Recipients: []age.Recipient{id.Recipient()}}
+
+	path := filepath.Join(c.MkDir(), "test.age")
+	n, err := ParseString("machine m\nlogin l\npassword p\n")
+	c.Assert(err, IsNil)
+	n.Path = path
+	c.Assert(n.SaveWithCipher(ac), IsNil)
+
+	body, err := ioutil.ReadFile(path)
+	c.Assert(err, IsNil)
+	c.Check(string(body), Not(Equals), n.Render())
+
+	got, err := ParseWithCipher(path, ac)
+	c.Assert(err, IsNil)
+	c.Check(got.Machine("m").Get("login"), Equals, "l")
+	c.Check(got.Machine("m").Get("password"), Equals, "p")
+}
+
+func (s *CipherSuite) TestRegisterCipher(c *C) {
+	rc := &recordingCipher{}
+	RegisterCipher(".testcipher", rc)
+	defer delete(ciphers, ".testcipher")
+
+	path := filepath.Join(c.MkDir(), "test.testcipher")
+	c.Assert(ioutil.WriteFile(path, []byte("machine m\nlogin l\npassword p\n"), 0600), IsNil)
+
+	_, err := Parse(path)
+	c.Assert(err, IsNil)
+	c.Check(rc.decrypted, Equals, true)
+}
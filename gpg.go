@@ -0,0 +1,65 @@
+package netrc
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"os/exec"
+)
+
+// GPGCipher shells out to the gpg binary to decrypt and encrypt netrc
+// files using the user's default recipient key. It is registered for
+// the ".gpg" extension by default.
+type GPGCipher struct {
+	// Stderr receives gpg's standard error output. Defaults to
+	// os.Stderr when nil.
+	Stderr io.Writer
+}
+
+func (g *GPGCipher) stderr() io.Writer {
+	if g.Stderr != nil {
+		return g.Stderr
+	}
+	return os.Stderr
+}
+
+// Decrypt runs "gpg --decrypt" over r and returns the plaintext.
+func (g *GPGCipher) Decrypt(r io.Reader) (io.Reader, error) {
+	cmd := exec.Command("gpg", "--batch", "--quiet", "--decrypt")
+	cmd.Stdin = r
+	cmd.Stderr = g.stderr()
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(out), nil
+}
+
+// Encrypt returns a WriteCloser that buffers plaintext written to it
+// and, on Close, runs "gpg -e" for the default recipient and writes the
+// resulting ciphertext to w.
+func (g *GPGCipher) Encrypt(w io.Writer) (io.WriteCloser, error) {
+	return &gpgEncryptor{w: w, stderr: g.stderr()}, nil
+}
+
+type gpgEncryptor struct {
+	w      io.Writer
+	stderr io.Writer
+	buf    bytes.Buffer
+}
+
+func (e *gpgEncryptor) Write(p []byte) (int, error) {
+	return e.buf.Write(p)
+}
+
+func (e *gpgEncryptor) Close() error {
+	cmd := exec.Command("gpg", "-a", "--batch", "--default-recipient-self", "-e")
+	cmd.Stdin = &e.buf
+	cmd.Stderr = e.stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return err
+	}
+	_, err = e.w.Write(out)
+	return err
+}
@@ -0,0 +1,73 @@
+package netrc
+
+import (
+	"net/http"
+	"net/url"
+)
+
+// MachineForURL returns the Login that should be used for a request to
+// u, preferring an entry declared for the exact "host:port" over one
+// for the bare host (see Machine), and finally falling back to the
+// default entry. If u.User carries a username it is used to pick
+// between multiple logins defined for the same machine.
+//
+// Transport does NOT use this fallback to the default entry: a caller
+// installing Transport globally has not named u.Host, so silently
+// attaching the default credentials to it (including a redirect target
+// that has nothing to do with the original request) would leak them to
+// any host the process happens to talk to. MachineForURL itself still
+// returns the default entry, since a caller invoking it directly for a
+// specific URL has opted into that fallback.
+func (n *Netrc) MachineForURL(u *url.URL) *Login {
+	return n.machineForURL(u, true)
+}
+
+func (n *Netrc) machineForURL(u *url.URL, allowDefault bool) *Login {
+	if login := u.User.Username(); login != "" {
+		if m := n.MachineAndLogin(u.Host, login); m != nil {
+			return m
+		}
+	}
+
+	if m := n.Machine(u.Host); m != nil {
+		return m
+	}
+
+	if allowDefault {
+		return n.Machine("default")
+	}
+	return nil
+}
+
+// netrcTransport wraps another http.RoundTripper, injecting Basic Auth
+// credentials looked up from a Netrc.
+type netrcTransport struct {
+	netrc *Netrc
+	base  http.RoundTripper
+}
+
+// Transport wraps base (http.DefaultTransport if base is nil) so that
+// every outbound request without an Authorization header is given the
+// credentials found for its URL's host, without falling back to the
+// default entry (see MachineForURL). Note this means Transport does not
+// behave like curl/git-credential tooling that honors a bare "default"
+// netrc entry for any host; only MachineForURL exercises that fallback.
+func (n *Netrc) Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &netrcTransport{netrc: n, base: base}
+}
+
+func (t *netrcTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("Authorization") == "" {
+		if m := t.netrc.machineForURL(req.URL, false); m != nil {
+			login, password := m.Login(), m.Password()
+			if login != "" || password != "" {
+				req = req.Clone(req.Context())
+				req.SetBasicAuth(login, password)
+			}
+		}
+	}
+	return t.base.RoundTrip(req)
+}
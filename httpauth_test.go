@@ -0,0 +1,157 @@
+package netrc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	. "gopkg.in/check.v1"
+)
+
+type HTTPAuthSuite struct{}
+
+var _ = Suite(&HTTPAuthSuite{})
+
+const httpAuthNetrc = `
+machine api.example.com:8443
+login porty
+password portpass
+
+machine api.example.com
+login plain
+password plainpass
+
+default
+login defuser
+password defpass
+`
+
+func (s *HTTPAuthSuite) TestMachineForURL(c *C) {
+	n, err := ParseString(httpAuthNetrc)
+	c.Assert(err, IsNil)
+
+	u, _ := url.Parse("https://api.example.com:8443/path")
+	c.Check(n.MachineForURL(u).Get("login"), Equals, "porty")
+
+	u, _ = url.Parse("https://api.example.com/path")
+	c.Check(n.MachineForURL(u).Get("login"), Equals, "plain")
+
+	u, _ = url.Parse("https://unknown.example.com/path")
+	c.Check(n.MachineForURL(u).Get("login"), Equals, "defuser")
+}
+
+func (s *HTTPAuthSuite) TestMachineForURLWithUserinfo(c *C) {
+	n, err := ParseString(`
+machine example.com
+login first
+password firstpass
+
+machine example.com
+login second
+password secondpass
+`)
+	c.Assert(err, IsNil)
+
+	u, _ := url.Parse("https://second@example.com/path")
+	c.Check(n.MachineForURL(u).Get("password"), Equals, "secondpass")
+}
+
+func (s *HTTPAuthSuite) TestTransportSetsBasicAuth(c *C) {
+	n, err := ParseString(`
+machine api.example.com
+login tuser
+password tpass
+`)
+	c.Assert(err, IsNil)
+
+	var gotUser, gotPass string
+	var gotOK bool
+	rt := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		gotUser, gotPass, gotOK = req.BasicAuth()
+		return httptest.NewRecorder().Result(), nil
+	})
+
+	req, _ := http.NewRequest("GET", "https://api.example.com/path", nil)
+	_, err = n.Transport(rt).RoundTrip(req)
+	c.Assert(err, IsNil)
+	c.Check(gotOK, Equals, true)
+	c.Check(gotUser, Equals, "tuser")
+	c.Check(gotPass, Equals, "tpass")
+}
+
+func (s *HTTPAuthSuite) TestTransportPreservesExistingAuth(c *C) {
+	n, err := ParseString(`
+machine api.example.com
+login tuser
+password tpass
+`)
+	c.Assert(err, IsNil)
+
+	var gotAuth string
+	rt := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		gotAuth = req.Header.Get("Authorization")
+		return httptest.NewRecorder().Result(), nil
+	})
+
+	req, _ := http.NewRequest("GET", "https://api.example.com/path", nil)
+	req.Header.Set("Authorization", "Bearer preexisting")
+	_, err = n.Transport(rt).RoundTrip(req)
+	c.Assert(err, IsNil)
+	c.Check(gotAuth, Equals, "Bearer preexisting")
+}
+
+func (s *HTTPAuthSuite) TestTransportDoesNotLeakDefaultToUnrelatedHost(c *C) {
+	n, err := ParseString(`
+default
+login defuser
+password defpass
+`)
+	c.Assert(err, IsNil)
+
+	var gotOK bool
+	rt := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		_, _, gotOK = req.BasicAuth()
+		return httptest.NewRecorder().Result(), nil
+	})
+
+	req, _ := http.NewRequest("GET", "https://totally-unrelated-evil.example/path", nil)
+	_, err = n.Transport(rt).RoundTrip(req)
+	c.Assert(err, IsNil)
+	c.Check(gotOK, Equals, false)
+}
+
+func (s *HTTPAuthSuite) TestTransportDoesNotLeakDefaultAcrossRedirect(c *C) {
+	var gotAuthB string
+	serverB := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuthB = r.Header.Get("Authorization")
+	}))
+	defer serverB.Close()
+
+	var gotAuthA string
+	serverA := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuthA = r.Header.Get("Authorization")
+		http.Redirect(w, r, serverB.URL, http.StatusFound)
+	}))
+	defer serverA.Close()
+
+	n, err := ParseString(`
+default
+login defuser
+password defpass
+`)
+	c.Assert(err, IsNil)
+
+	client := &http.Client{Transport: n.Transport(nil)}
+	resp, err := client.Get(serverA.URL)
+	c.Assert(err, IsNil)
+	resp.Body.Close()
+
+	c.Check(gotAuthA, Equals, "")
+	c.Check(gotAuthB, Equals, "")
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
@@ -6,10 +6,12 @@ import (
 	"errors"
 	"io"
 	"io/ioutil"
+	"net"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"regexp"
+	"runtime"
+	"strings"
 	"unicode"
 )
 
@@ -28,16 +30,30 @@ type Login struct {
 	Name      string
 	IsDefault bool
 	tokens    []string
+	// scanEnd bounds how far Get/Set scan into tokens for key/value
+	// pairs. It is -1 when the whole of tokens is structured; a macdef
+	// sets it to the token index where the opaque macro body begins, so
+	// words inside the macro (which may legally look like "machine" or
+	// "password") are never mistaken for credentials.
+	scanEnd int
 }
 
-// Parse the netrc file at the given path
+// Parse the netrc file at the given path, decrypting it first with the
+// Cipher registered for its extension, if any.
 // It returns a Netrc instance
 func Parse(path string) (*Netrc, error) {
-	file, err := read(path)
+	return ParseWithCipher(path, cipherFor(path))
+}
+
+// ParseWithCipher parses the netrc file at path like Parse, but decrypts
+// it with c instead of inferring a Cipher from the file extension. A nil
+// c means the file is read as plaintext.
+func ParseWithCipher(path string, c Cipher) (*Netrc, error) {
+	file, err := read(path, c)
 	if err != nil {
 		return nil, err
 	}
-	netrc, err := parse(lex(file))
+	netrc, err := ParseReader(file)
 	if err != nil {
 		return nil, err
 	}
@@ -45,8 +61,94 @@ func Parse(path string) (*Netrc, error) {
 	return netrc, nil
 }
 
-// Machine gets a login by machine name
+// ParseReader parses netrc formatted data from r.
+// It returns a Netrc instance
+func ParseReader(r io.Reader) (*Netrc, error) {
+	return parse(lex(r))
+}
+
+// ParseString parses netrc formatted data from s.
+// It returns a Netrc instance
+func ParseString(s string) (*Netrc, error) {
+	return ParseReader(strings.NewReader(s))
+}
+
+// Default parses the netrc file pointed to by the NETRC environment
+// variable, falling back to the user's home directory (.netrc, or
+// _netrc on Windows) when NETRC is unset.
+func Default() (*Netrc, error) {
+	if path := os.Getenv("NETRC"); path != "" {
+		return Parse(path)
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+	return Parse(filepath.Join(home, defaultName(runtime.GOOS)))
+}
+
+// defaultName returns the default netrc filename for the given GOOS, so
+// the Windows-vs-everything-else branch in Default is testable without
+// actually running on Windows.
+func defaultName(goos string) string {
+	if goos == "windows" {
+		return "_netrc"
+	}
+	return ".netrc"
+}
+
+// Machine gets a login by machine name. name may be "host:port", in
+// which case an entry declared as the exact "host:port" is preferred,
+// falling back to one declared as the bare host. See MachinesFor to get
+// every match instead of just the most specific one.
 func (n *Netrc) Machine(name string) *Login {
+	var fallback *Login
+	for _, m := range n.MachinesFor(name) {
+		if m.Name == name {
+			return m
+		}
+		if fallback == nil {
+			fallback = m
+		}
+	}
+	return fallback
+}
+
+// MachinesFor returns every Login whose Name matches host, in file
+// order. If host is "host:port", this matches entries declared as
+// either the exact "host:port" or the bare host, so callers talking to
+// a non-default port can share one netrc with tools (e.g. browsers)
+// that only ever look up the bare host. Use this when more than one
+// login may exist for a host; MachineAndLogin and Machine are built on
+// top of it.
+func (n *Netrc) MachinesFor(host string) []*Login {
+	bareHost, _, err := net.SplitHostPort(host)
+	hasPort := err == nil
+	var matches []*Login
+	for _, m := range n.logins {
+		if m.Name == host || (hasPort && m.Name == bareHost) {
+			matches = append(matches, m)
+		}
+	}
+	return matches
+}
+
+// MachineAndLogin gets a login by machine name and login name, for when
+// multiple logins are defined for one machine.
+func (n *Netrc) MachineAndLogin(name, login string) *Login {
+	for _, m := range n.MachinesFor(name) {
+		if m.Get("login") == login {
+			return m
+		}
+	}
+	return nil
+}
+
+// machineExact finds a Login by exact Name match, with none of Machine's
+// host:port fallback behavior. AddMachine needs this: Machine's fallback
+// match would otherwise make AddMachine("host:port", ...) clobber an
+// existing bare-host entry instead of adding a new, more specific one.
+func (n *Netrc) machineExact(name string) *Login {
 	for _, m := range n.logins {
 		if m.Name == name {
 			return m
@@ -57,13 +159,14 @@ func (n *Netrc) Machine(name string) *Login {
 
 // AddMachine adds a machine
 func (n *Netrc) AddMachine(name, login, password string) {
-	machine := n.Machine(name)
+	machine := n.machineExact(name)
 	if machine == nil {
-		machine = &Login{}
+		machine = &Login{scanEnd: -1}
 		n.logins = append(n.logins, machine)
 	}
 	machine.Name = name
-	machine.tokens = []string{"machine ", name, "\n"}
+	machine.tokens = []string{"machine", " ", name, "\n"}
+	machine.scanEnd = -1
 	machine.Set("login", login)
 	machine.Set("password", password)
 }
@@ -94,41 +197,52 @@ func (n *Netrc) Render() string {
 	return b.String()
 }
 
-// Save the file to disk
+// Save the file to disk, encrypting it first with the Cipher registered
+// for its extension, if any.
 func (n *Netrc) Save() error {
+	return n.SaveWithCipher(cipherFor(n.Path))
+}
+
+// SaveWithCipher writes the file to disk like Save, but encrypts it with
+// c instead of inferring a Cipher from the file extension. A nil c means
+// the file is written as plaintext.
+func (n *Netrc) SaveWithCipher(c Cipher) error {
 	body := []byte(n.Render())
-	if filepath.Ext(n.Path) == ".gpg" {
-		cmd := exec.Command("gpg", "-a", "--batch", "--default-recipient-self", "-e")
-		stdin, err := cmd.StdinPipe()
+	if c != nil {
+		var buf bytes.Buffer
+		w, err := c.Encrypt(&buf)
 		if err != nil {
 			return err
 		}
-		stdin.Write(body)
-		stdin.Close()
-		cmd.Stderr = os.Stderr
-		body, err = cmd.Output()
-		if err != nil {
+		if _, err := w.Write(body); err != nil {
 			return err
 		}
+		if err := w.Close(); err != nil {
+			return err
+		}
+		body = buf.Bytes()
 	}
 	return ioutil.WriteFile(n.Path, body, 0600)
 }
 
-func read(path string) (io.Reader, error) {
-	if filepath.Ext(path) == ".gpg" {
-		cmd := exec.Command("gpg", "--batch", "--quiet", "--decrypt", path)
-		cmd.Stderr = os.Stderr
-		stdout, err := cmd.StdoutPipe()
-		if err != nil {
-			return nil, err
-		}
-		err = cmd.Start()
-		if err != nil {
-			return nil, err
-		}
-		return stdout, nil
+func read(path string, c Cipher) (io.Reader, error) {
+	if c == nil {
+		return os.Open(path)
+	}
+	// Read the whole (small) ciphertext file up front so the file
+	// descriptor can be closed here: c.Decrypt may return a reader that
+	// lazily streams its plaintext rather than draining its input
+	// eagerly, and we can't keep path open for however long the caller
+	// takes to read the result.
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
 	}
-	return os.Open(path)
+	return c.Decrypt(bytes.NewReader(raw))
+}
+
+func cipherFor(path string) Cipher {
+	return ciphers[filepath.Ext(path)]
 }
 
 func lex(file io.Reader) []string {
@@ -182,11 +296,13 @@ func parse(tokens []string) (*Netrc, error) {
 	n := &Netrc{}
 	n.logins = make([]*Login, 0, 20)
 	var machine *Login
-	for i, token := range tokens {
-		// group tokens into machines
+	for i := 0; i < len(tokens); i++ {
+		token := tokens[i]
+		// group tokens into machines; a machine/default token always
+		// starts a new group, so it (and everything after it) belongs
+		// to the new login, never the one that preceded it
 		if token == "machine" || token == "default" {
-			// start new group
-			machine = &Login{}
+			machine = &Login{scanEnd: -1}
 			n.logins = append(n.logins, machine)
 			if token == "default" {
 				machine.IsDefault = true
@@ -195,23 +311,75 @@ func parse(tokens []string) (*Netrc, error) {
 				machine.Name = tokens[i+2]
 			}
 		}
+		// macdef introduces a macro body terminated by a blank line;
+		// everything from here until that blank line is opaque and must
+		// not be parsed as key/value tokens (it may legally contain
+		// words like "machine" or "password"), so freeze the current
+		// login's scan boundary before appending the macdef token itself
+		if token == "macdef" && machine != nil && machine.scanEnd == -1 {
+			machine.scanEnd = len(machine.tokens)
+		}
 		if machine == nil {
 			n.tokens = append(n.tokens, token)
 		} else {
 			machine.tokens = append(machine.tokens, token)
 		}
+		if token == "macdef" {
+			for i+1 < len(tokens) {
+				i++
+				t := tokens[i]
+				if machine == nil {
+					n.tokens = append(n.tokens, t)
+				} else {
+					machine.tokens = append(machine.tokens, t)
+				}
+				if strings.Contains(t, "\n\n") {
+					break
+				}
+			}
+		}
 	}
 	return n, nil
 }
 
+// Login returns the "login" property.
+func (m *Login) Login() string {
+	return m.Get("login")
+}
+
+// Password returns the "password" property.
+func (m *Login) Password() string {
+	return m.Get("password")
+}
+
+// Account returns the "account" property.
+func (m *Login) Account() string {
+	return m.Get("account")
+}
+
+// Port returns the "port" property.
+func (m *Login) Port() string {
+	return m.Get("port")
+}
+
+// scanLimit returns how far into tokens Get/Set may look for key/value
+// pairs, stopping short of any opaque macdef trailer.
+func (m *Login) scanLimit() int {
+	if m.scanEnd >= 0 {
+		return m.scanEnd
+	}
+	return len(m.tokens)
+}
+
 // Get a property from a machine
 func (m *Login) Get(name string) string {
 	i := 4
 	if m.IsDefault {
 		i = 2
 	}
+	limit := m.scanLimit()
 	for {
-		if i+2 >= len(m.tokens) {
+		if i+2 >= limit {
 			return ""
 		}
 		if m.tokens[i] == name {
@@ -227,12 +395,26 @@ func (m *Login) Set(name, value string) {
 	if m.IsDefault {
 		i = 2
 	}
-	for i+2 < len(m.tokens) {
+	limit := m.scanLimit()
+	for i+2 < limit {
 		if m.tokens[i] == name {
 			m.tokens[i+2] = value
 			return
 		}
 		i = i + 4
 	}
-	m.tokens = append(m.tokens, "  ", name, " ", value, "\n")
+	// 4 tokens per pair (key, sep, value, trailing whitespace), matching
+	// the stride Get/Set scan with and what the lexer itself produces;
+	// a stray 5th leading token here used to throw that alignment off
+	// for every key appended after the first.
+	newTokens := []string{name, " ", value, "\n"}
+	if m.scanEnd < 0 {
+		m.tokens = append(m.tokens, newTokens...)
+		return
+	}
+	// insert before the opaque macdef trailer rather than after it, so
+	// the new pair stays within the scanned region
+	tail := append([]string{}, m.tokens[m.scanEnd:]...)
+	m.tokens = append(append(m.tokens[:m.scanEnd:m.scanEnd], newTokens...), tail...)
+	m.scanEnd += len(newTokens)
 }
@@ -1,6 +1,9 @@
 package netrc
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 
 	. "gopkg.in/check.v1"
@@ -86,3 +89,167 @@ func (s *NetrcSuite) TestPermissive(c *C) {
 	c.Check(f.Machine("m").Get("login"), Equals, "l")
 	c.Check(f.Machine("m").Get("password"), Equals, "p")
 }
+
+func (s *NetrcSuite) TestMacdef(c *C) {
+	f, err := ParseString(`machine m
+login l
+password p
+
+macdef init
+machine evil
+password should-not-be-parsed
+
+machine n
+login ln
+password pn
+`)
+	c.Assert(err, IsNil)
+	c.Check(f.Machine("m").Get("login"), Equals, "l")
+	c.Check(f.Machine("n").Get("login"), Equals, "ln")
+	c.Check(f.Machine("evil"), IsNil)
+}
+
+func (s *NetrcSuite) TestMacdefRoundTrip(c *C) {
+	raw := `# a leading comment
+machine m
+login l
+password p
+
+macdef init
+machine evil
+password should-not-be-parsed
+
+machine n
+login ln
+password pn
+`
+	f, err := ParseString(raw)
+	c.Assert(err, IsNil)
+	c.Check(f.Render(), Equals, raw)
+}
+
+func (s *NetrcSuite) TestMacdefDoesNotLeakIntoPrecedingMachine(c *C) {
+	f, err := ParseString(`machine m
+login l
+
+macdef init
+password injected-secret
+
+machine n
+login ln
+password pn
+`)
+	c.Assert(err, IsNil)
+	c.Check(f.Machine("m").Get("password"), Equals, "")
+	c.Check(f.Machine("n").Get("password"), Equals, "pn")
+}
+
+func (s *NetrcSuite) TestBadDefaultOrderString(c *C) {
+	f, err := ParseString(`default
+login demo
+password mypassword
+
+machine mail.google.com
+login joe@gmail.com
+password somethingSecret
+`)
+	c.Assert(err, IsNil)
+	c.Check(f.Machine("mail.google.com").Get("login"), Equals, "joe@gmail.com")
+	c.Check(f.Machine("mail.google.com").Get("password"), Equals, "somethingSecret")
+	c.Check(f.Machine("default").Get("login"), Equals, "demo")
+	c.Check(f.Machine("default").Get("password"), Equals, "mypassword")
+}
+
+func (s *NetrcSuite) TestTwoLoginsSameMachine(c *C) {
+	f, err := ParseString(`machine example.com
+login first
+password firstpass
+
+machine example.com
+login second
+password secondpass
+`)
+	c.Assert(err, IsNil)
+	c.Check(f.Machine("example.com").Get("login"), Equals, "first")
+	c.Check(f.MachineAndLogin("example.com", "second").Get("password"), Equals, "secondpass")
+	c.Check(f.MachinesFor("example.com"), HasLen, 2)
+}
+
+func (s *NetrcSuite) TestMachinePort(c *C) {
+	f, err := ParseString(`machine api.example.com:8443
+login porty
+password portpass
+
+machine api.example.com
+login plain
+password plainpass
+`)
+	c.Assert(err, IsNil)
+	c.Check(f.Machine("api.example.com:8443").Login(), Equals, "porty")
+	c.Check(f.Machine("api.example.com").Login(), Equals, "plain")
+}
+
+func (s *NetrcSuite) TestAddMachineDoesNotClobberPortFallback(c *C) {
+	f, err := ParseString("machine api.example.com\nlogin plain\npassword plainpass\n")
+	c.Assert(err, IsNil)
+	f.AddMachine("api.example.com:8443", "porty", "portpass")
+	c.Check(f.Machine("api.example.com").Login(), Equals, "plain")
+	c.Check(f.Machine("api.example.com").Password(), Equals, "plainpass")
+	c.Check(f.Machine("api.example.com:8443").Login(), Equals, "porty")
+	c.Check(f.Machine("api.example.com:8443").Password(), Equals, "portpass")
+}
+
+func (s *NetrcSuite) TestLoginAccessors(c *C) {
+	f, err := ParseString(`machine mail.google.com
+login joe@gmail.com
+account justagmail
+password somethingSecret
+`)
+	c.Assert(err, IsNil)
+	m := f.Machine("mail.google.com")
+	c.Check(m.Login(), Equals, "joe@gmail.com")
+	c.Check(m.Password(), Equals, "somethingSecret")
+	c.Check(m.Account(), Equals, "justagmail")
+	c.Check(m.Port(), Equals, "")
+}
+
+func (s *NetrcSuite) TestDefaultHonorsNETRC(c *C) {
+	path := filepath.Join(c.MkDir(), "custom.netrc")
+	c.Assert(ioutil.WriteFile(path, []byte("machine m\nlogin l\npassword p\n"), 0600), IsNil)
+
+	c.Assert(os.Setenv("NETRC", path), IsNil)
+	defer os.Unsetenv("NETRC")
+
+	f, err := Default()
+	c.Assert(err, IsNil)
+	c.Check(f.Path, Equals, path)
+	c.Check(f.Machine("m").Get("login"), Equals, "l")
+}
+
+func (s *NetrcSuite) TestDefaultFallsBackToHomeNetrc(c *C) {
+	c.Assert(os.Unsetenv("NETRC"), IsNil)
+
+	home := c.MkDir()
+	c.Assert(ioutil.WriteFile(filepath.Join(home, ".netrc"), []byte("machine m\nlogin l\npassword p\n"), 0600), IsNil)
+
+	oldHome, hadHome := os.LookupEnv("HOME")
+	c.Assert(os.Setenv("HOME", home), IsNil)
+	defer func() {
+		if hadHome {
+			os.Setenv("HOME", oldHome)
+		} else {
+			os.Unsetenv("HOME")
+		}
+	}()
+
+	f, err := Default()
+	c.Assert(err, IsNil)
+	c.Check(f.Path, Equals, filepath.Join(home, ".netrc"))
+	c.Check(f.Machine("m").Get("login"), Equals, "l")
+}
+
+func (s *NetrcSuite) TestDefaultName(c *C) {
+	c.Check(defaultName("windows"), Equals, "_netrc")
+	c.Check(defaultName("linux"), Equals, ".netrc")
+	c.Check(defaultName("darwin"), Equals, ".netrc")
+}